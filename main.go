@@ -4,19 +4,132 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// IndexEntry represents an entry in the in-memory index
+// tombstoneValueLen marks a record as a deletion tombstone: the key is
+// present in the record but no value bytes follow it.
+const tombstoneValueLen = -1
+
+// Segment format versions. v0 is the original header (no expiry field); v1
+// adds an expiry field for TTL support; v2 adds a kind byte so a record can
+// be a chunk fragment or chunk index instead of only a plain put; v3
+// replaces the additive CRC with CRC-32/IEEE over the framed payload, but
+// only over timestamp/keyLen/valueLen/key/value; v4 folds expiry and kind
+// into that same CRC-32/IEEE so a corrupted expiry or kind byte is detected
+// instead of silently mis-dispatching or dropping the record. Every segment
+// file now starts with one of these as its first byte.
+const (
+	segmentVersionV0 byte = 0
+	segmentVersionV1 byte = 1
+	segmentVersionV2 byte = 2
+	segmentVersionV3 byte = 3
+	segmentVersionV4 byte = 4
+)
+
+// Record kinds, stored in the kind byte added in v2. recordKindPut covers
+// both ordinary values and tombstones (tombstones are still distinguished by
+// valueLen == tombstoneValueLen). The chunk kinds are written by PutStream
+// and are never surfaced through Get/Put.
+const (
+	recordKindPut           byte = 0
+	recordKindChunkFragment byte = 1
+	recordKindChunkIndex    byte = 2
+)
+
+// chunkSize is the maximum number of value bytes PutStream writes per
+// fragment record, so a single value never needs to be buffered whole.
+const chunkSize = 4 * 1024 * 1024
+
+// recordHeaderSize is the fixed-size portion of every v2+ record: CRC(4) +
+// timestamp(8) + keyLen(4) + valueLen(4) + expiry(8) + kind(1), before the
+// key bytes.
+const recordHeaderSize = 29
+
+// maxKeyLen and maxValueLen bound the keyLen/valueLen read from a record
+// header, so a corrupt header can't make Get allocate an absurd amount of
+// memory before the CRC check has a chance to reject it.
+const (
+	maxKeyLen   = 1 << 20          // 1 MiB
+	maxValueLen = 64 * 1024 * 1024 // 64 MiB: comfortably above chunkSize
+)
+
+// maxReplicationMessageSize bounds the length prefix read off a replication
+// connection, so a corrupt or hostile peer can't make a server allocate an
+// absurd amount of memory before the message is even parsed. A publishMessage
+// carries a raw record JSON-encoded, which both base64's its Data field
+// (a 4/3 expansion) and adds field-name overhead, so the bound needs
+// meaningful headroom over the largest raw record rather than matching it
+// exactly.
+const maxReplicationMessageSize = (maxValueLen+maxKeyLen+recordHeaderSize)*4/3 + 4096
+
+// expirySweepInterval is how often the background sweeper looks for and
+// evicts expired keys.
+const expirySweepInterval = 30 * time.Second
+
+// replicationDialTimeout bounds how long Publish and the /replicas
+// reachability check wait to connect to a peer, so one unreachable peer
+// can't stall a Put/Delete (or the status endpoint) for an OS-level
+// connect timeout.
+const replicationDialTimeout = 2 * time.Second
+
+// ErrKeyNotFound is returned when a key has no live value in the store.
+var ErrKeyNotFound = errors.New("bitcask: key not found")
+
+// ErrKeyExpired is returned when a key's TTL has elapsed; the sweeper will
+// eventually tombstone it, but Get reports it as expired as soon as it sees it.
+var ErrKeyExpired = errors.New("bitcask: key expired")
+
+// ErrValueChunked is returned by Get when key was written with PutStream;
+// GetStream must be used to read it instead.
+var ErrValueChunked = errors.New("bitcask: value was stored with PutStream; use GetStream")
+
+// ErrValueNotChunked is returned by GetStream when key was written with Put;
+// Get must be used to read it instead.
+var ErrValueNotChunked = errors.New("bitcask: value was not stored with PutStream; use Get")
+
+// ChunkLocation identifies one fragment of a streamed value: length bytes
+// starting at offset in fileName.
+type ChunkLocation struct {
+	FileName string
+	Offset   int64
+	Length   int64
+}
+
+// IndexEntry represents an entry in the in-memory index. A plain value uses
+// FileName/Offsets as before. A value written with PutStream instead sets
+// Chunked and Chunks, an ordered list of the fragments that make it up;
+// FileName/Offsets still point at the chunk index record itself so Delete
+// and the expiry sweeper work unchanged.
 type IndexEntry struct {
 	FileName string
 	Offsets  []int64
+	Chunked  bool
+	Chunks   []ChunkLocation
+}
+
+// hintEntry is one record of a segment's companion hint file: enough to
+// locate and size a value without reading the full data file. Expiry is
+// carried too so the hint-file recovery path can drop an already-expired
+// key the same way a full scan does, instead of indexing it as live.
+type hintEntry struct {
+	Key       string
+	ValueLen  int32
+	Offset    int64
+	Timestamp int64
+	Expiry    int64
 }
 
 // Bitcask represents the key-value store
@@ -27,34 +140,72 @@ type Bitcask struct {
 	currentFileSize int64       // Size of the current active file
 	maxFileSize     int64       // Max size for a single file
 	activeFileMu    sync.Mutex  // Lock for managing the active file
+	pendingHints    []hintEntry // Hint entries accumulated for the active file
+	hintsIncomplete bool        // true once a non-put record lands in the active file, or it was resumed with records; suppresses its hint file
+	repo            string      // namespace this instance was Registered under, if any
+	replicator      *Replicator // set by Replicator.Register; nil means replication is off
 }
 
-// NewBitcask initializes a new Bitcask instance
+// NewBitcask initializes a new Bitcask instance, resuming the
+// most-recently-written segment in dataDir as the active file if one
+// already exists, rather than always reopening "segment.log" — otherwise a
+// restart would abandon the real last-active segment mid-size and resume
+// writing into whatever old, already-rotated-away segment happens to have
+// that literal name.
 func NewBitcask(dataDir string, maxFileSize int64) (*Bitcask, error) {
 	err := os.MkdirAll(dataDir, 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := os.OpenFile(filepath.Join(dataDir, "segment.log"), os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	bc := &Bitcask{
+		dataDir:     dataDir,
+		maxFileSize: maxFileSize,
+	}
+
+	activePath := filepath.Join(dataDir, "segment.log")
+	segments, err := bc.listSegmentFiles()
 	if err != nil {
 		return nil, err
 	}
+	if len(segments) > 0 {
+		activePath = segments[len(segments)-1].path
+	}
 
-	return &Bitcask{
-		dataDir:     dataDir,
-		currentFile: file,
-		maxFileSize: maxFileSize,
-	}, nil
+	file, err := os.OpenFile(activePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	bc.currentFile = file
+
+	if err := bc.recover(); err != nil {
+		return nil, err
+	}
+
+	bc.startExpirySweeper(expirySweepInterval)
+
+	return bc, nil
 }
 
 // rotateFile creates a new segment file when the current file exceeds the size limit
 func (bc *Bitcask) rotateFile() error {
-	
+
+	oldPath := bc.currentFile.Name()
 	if err := bc.currentFile.Close(); err != nil {
 		return err
 	}
 
+	if bc.hintsIncomplete {
+		// The active file holds chunk fragments or a chunk index record,
+		// which the hint format can't represent; force a full scan of it on
+		// the next recovery instead of trusting a hint that would miss them.
+		os.Remove(hintPathFor(oldPath))
+	} else if err := bc.writeHintFile(oldPath, bc.pendingHints); err != nil {
+		log.Printf("Error writing hint file for %s: %v", oldPath, err)
+	}
+	bc.pendingHints = nil
+	bc.hintsIncomplete = false
+
 	newFileName := fmt.Sprintf("segment-%d.log", time.Now().UnixMicro())
 	newFilePath := filepath.Join(bc.dataDir, newFileName)
 
@@ -63,65 +214,266 @@ func (bc *Bitcask) rotateFile() error {
 		return err
 	}
 
+	if _, err := file.Write([]byte{segmentVersionV4}); err != nil {
+		return err
+	}
+
 	bc.currentFile = file
-	bc.currentFileSize = 0
+	bc.currentFileSize = 1
 	return nil
 }
 
-// Put stores a key-value pair in the active file
-func (bc *Bitcask) Put(key, value string) error {
+// hintPathFor returns the companion hint file path for a segment data file.
+func hintPathFor(logPath string) string {
+	return strings.TrimSuffix(logPath, filepath.Ext(logPath)) + ".hint"
+}
+
+// writeHintFile persists entries as logPath's companion hint file so a
+// future restart can rebuild the index for that segment without rescanning
+// and CRC-checking every record in the full data file.
+func (bc *Bitcask) writeHintFile(logPath string, entries []hintEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	file, err := os.OpenFile(hintPathFor(logPath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var buffer bytes.Buffer
+	for _, e := range entries {
+		binary.Write(&buffer, binary.LittleEndian, int32(len(e.Key)))
+		buffer.WriteString(e.Key)
+		binary.Write(&buffer, binary.LittleEndian, e.ValueLen)
+		binary.Write(&buffer, binary.LittleEndian, e.Offset)
+		binary.Write(&buffer, binary.LittleEndian, e.Timestamp)
+		binary.Write(&buffer, binary.LittleEndian, e.Expiry)
+	}
+
+	_, err = file.Write(buffer.Bytes())
+	return err
+}
+
+// writeFramedRecord serializes one record to the active file and returns the
+// file it landed in and the offset it started at. A tombstone record
+// carries no value bytes and encodes valueLen as tombstoneValueLen so
+// readers know the key has been deleted. expiry is a unix-nanos deadline, or
+// 0 if the record never expires. updateIndex controls whether the record is
+// also applied to bc.index as a normal key/value lookup; chunk fragments are
+// written with updateIndex false since they're only ever reached through
+// their key's chunk index record, not looked up directly. The raw framed
+// bytes are returned alongside the location so a Replicator can publish
+// them to peers verbatim, without re-reading the record back off disk.
+func (bc *Bitcask) writeFramedRecord(key string, value []byte, tombstone bool, expiry int64, kind byte, updateIndex bool) (string, int64, []byte, error) {
 	bc.activeFileMu.Lock()
 	defer bc.activeFileMu.Unlock()
 
-	// Serialize the data
 	timestamp := time.Now().Unix()
-	CRC := calculateCRC(key + value)
+
+	var valueLen int32
+	var CRC uint32
+	keyBytes := []byte(key)
+	if tombstone {
+		valueLen = tombstoneValueLen
+		CRC = calculateCRC(timestamp, int32(len(key)), valueLen, expiry, kind, keyBytes, nil)
+	} else {
+		valueLen = int32(len(value))
+		CRC = calculateCRC(timestamp, int32(len(key)), valueLen, expiry, kind, keyBytes, value)
+	}
 
 	var buffer bytes.Buffer
 	binary.Write(&buffer, binary.LittleEndian, CRC)
 	binary.Write(&buffer, binary.LittleEndian, timestamp)
 	binary.Write(&buffer, binary.LittleEndian, int32(len(key)))
-	binary.Write(&buffer, binary.LittleEndian, int32(len(value)))
+	binary.Write(&buffer, binary.LittleEndian, valueLen)
+	binary.Write(&buffer, binary.LittleEndian, expiry)
+	buffer.WriteByte(kind)
 	buffer.WriteString(key)
-	buffer.WriteString(value)
+	if !tombstone {
+		buffer.Write(value)
+	}
 
 	data := buffer.Bytes()
 
 	offset, err := bc.currentFile.Seek(0, os.SEEK_END)
 	if err != nil {
-		return err
+		return "", 0, nil, err
 	}
 
 	_, err = bc.currentFile.Write(data)
 	if err != nil {
-		return err
+		return "", 0, nil, err
+	}
+
+	if kind == recordKindPut {
+		bc.pendingHints = append(bc.pendingHints, hintEntry{Key: key, ValueLen: valueLen, Offset: offset, Timestamp: timestamp, Expiry: expiry})
+	} else {
+		bc.hintsIncomplete = true
 	}
 
+	fileName := bc.currentFile.Name()
+
 	bc.currentFileSize += int64(len(data))
 	if bc.currentFileSize > bc.maxFileSize {
-		//fmt.Print("in maxfilesize")
 		if err := bc.rotateFile(); err != nil {
-			return err
+			return "", 0, nil, err
+		}
+	}
+
+	if updateIndex {
+		bc.indexRecord(key, fileName, offset, tombstone)
+	}
+
+	return fileName, offset, data, nil
+}
+
+// appendRecord writes a plain put or tombstone record and returns the offset
+// it was written at. If bc has been Registered with a Replicator, the raw
+// framed record is published to its peers in the background once the write
+// succeeds, so a slow or unreachable peer costs Publish's dial timeout
+// instead of stalling the Put/Delete that triggered it.
+func (bc *Bitcask) appendRecord(key, value string, tombstone bool, expiry int64) (int64, error) {
+	fileName, offset, data, err := bc.writeFramedRecord(key, []byte(value), tombstone, expiry, recordKindPut, true)
+	if err != nil {
+		return 0, err
+	}
+	if bc.replicator != nil {
+		go bc.replicator.Publish(bc.repo, key, fileName, offset, data)
+	}
+	return offset, nil
+}
+
+// writeChunkFragment writes one fragment of a streamed value and returns the
+// file and offset of its raw value bytes (not the record header), ready to
+// use directly as a ChunkLocation. Fragments are never added to the index
+// directly; PutStream collects their locations into a ChunkLocation list and
+// writes that as the key's chunk index record.
+func (bc *Bitcask) writeChunkFragment(key string, chunk []byte) (string, int64, error) {
+	fileName, recordStart, _, err := bc.writeFramedRecord(key, chunk, false, 0, recordKindChunkFragment, false)
+	if err != nil {
+		return "", 0, err
+	}
+	return fileName, recordStart + recordHeaderSize + int64(len(key)), nil
+}
+
+// writeChunkIndexRecord writes the ordered list of chunk locations that make
+// up key's streamed value and points the in-memory index at it.
+func (bc *Bitcask) writeChunkIndexRecord(key string, chunks []ChunkLocation) error {
+	fileName, offset, _, err := bc.writeFramedRecord(key, encodeChunkLocations(chunks), false, 0, recordKindChunkIndex, false)
+	if err != nil {
+		return err
+	}
+	bc.index.Store(key, IndexEntry{FileName: fileName, Offsets: []int64{offset}, Chunked: true, Chunks: chunks})
+	return nil
+}
+
+// encodeChunkLocations serializes chunks as a count followed by, for each
+// entry, its file name, offset and length.
+func encodeChunkLocations(chunks []ChunkLocation) []byte {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, int32(len(chunks)))
+	for _, c := range chunks {
+		binary.Write(&buffer, binary.LittleEndian, int32(len(c.FileName)))
+		buffer.WriteString(c.FileName)
+		binary.Write(&buffer, binary.LittleEndian, c.Offset)
+		binary.Write(&buffer, binary.LittleEndian, c.Length)
+	}
+	return buffer.Bytes()
+}
+
+// decodeChunkLocations parses the payload written by encodeChunkLocations.
+func decodeChunkLocations(data []byte) ([]ChunkLocation, error) {
+	r := bytes.NewReader(data)
+	var count int32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, err
+	}
+	chunks := make([]ChunkLocation, 0, count)
+	for i := int32(0); i < count; i++ {
+		var nameLen int32
+		if err := binary.Read(r, binary.LittleEndian, &nameLen); err != nil {
+			return nil, err
+		}
+		nameBytes := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, nameBytes); err != nil {
+			return nil, err
+		}
+		var offset, length int64
+		if err := binary.Read(r, binary.LittleEndian, &offset); err != nil {
+			return nil, err
 		}
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, ChunkLocation{FileName: string(nameBytes), Offset: offset, Length: length})
+	}
+	return chunks, nil
+}
+
+// indexRecord applies a single decoded record to the in-memory index,
+// mirroring what appendRecord and recovery both need: a tombstone removes
+// the key entirely, while a live record is appended to the key's offsets.
+// Offsets only ever point into fileName, so a record that lands in a
+// different file than the key's current entry starts a fresh entry instead
+// of mixing offsets from two different files under one FileName.
+func (bc *Bitcask) indexRecord(key, fileName string, offset int64, tombstone bool) {
+	if tombstone {
+		bc.index.Delete(key)
+		return
 	}
 
-	// Update in-memory index
-	indexEntry, _ := bc.index.LoadOrStore(key, IndexEntry{FileName: bc.currentFile.Name(), Offsets: []int64{}})
-	entry := indexEntry.(IndexEntry)
+	var entry IndexEntry
+	if existing, ok := bc.index.Load(key); ok {
+		entry = existing.(IndexEntry)
+	}
+	if entry.FileName != fileName {
+		entry = IndexEntry{FileName: fileName}
+	}
 	entry.Offsets = append(entry.Offsets, offset)
 	bc.index.Store(key, entry)
+}
 
-	return nil
+// Put stores a key-value pair in the active file with no expiry.
+func (bc *Bitcask) Put(key, value string) error {
+	return bc.PutWithTTL(key, value, 0)
+}
+
+// PutWithTTL stores a key-value pair that Get will report as ErrKeyExpired,
+// and the background sweeper will tombstone, once ttl has elapsed. A ttl of
+// zero or less means the record never expires.
+func (bc *Bitcask) PutWithTTL(key, value string, ttl time.Duration) error {
+	var expiry int64
+	if ttl > 0 {
+		expiry = time.Now().Add(ttl).UnixNano()
+	}
+	_, err := bc.appendRecord(key, value, false, expiry)
+	return err
+}
+
+// Delete appends a tombstone record for key; appendRecord removes it from
+// the in-memory index so subsequent Gets report it as not found. The
+// tombstone stays on disk until Merge reclaims the space it and earlier
+// versions of the key occupy.
+func (bc *Bitcask) Delete(key string) error {
+	_, err := bc.appendRecord(key, "", true, 0)
+	return err
 }
 
-// Get retrieves all values associated with a key
-func (bc *Bitcask) Get(key string) ([]string, bool) {
+// Get retrieves all values associated with a key. It returns ErrKeyNotFound
+// if the key has no live entry, ErrKeyExpired if its TTL has elapsed, or
+// ErrValueChunked if the key was written with PutStream.
+func (bc *Bitcask) Get(key string) ([]string, error) {
 	// Retrieve index entry
 	indexEntryInterface, exists := bc.index.Load(key)
 	if !exists {
-		return nil, false
+		return nil, ErrKeyNotFound
 	}
 	indexEntry := indexEntryInterface.(IndexEntry)
+	if indexEntry.Chunked {
+		return nil, ErrValueChunked
+	}
 
 	var values []string
 	for _, offset := range indexEntry.Offsets {
@@ -138,20 +490,49 @@ func (bc *Bitcask) Get(key string) ([]string, bool) {
 			continue
 		}
 
-		var CRC int32
+		var CRC uint32
 		var timestamp int64
 		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
 		binary.Read(file, binary.LittleEndian, &CRC)
 		binary.Read(file, binary.LittleEndian, &timestamp)
 		binary.Read(file, binary.LittleEndian, &keyLen)
 		binary.Read(file, binary.LittleEndian, &valueLen)
+		binary.Read(file, binary.LittleEndian, &expiry)
+		binary.Read(file, binary.LittleEndian, &kind)
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			log.Printf("Key length %d out of bounds in %s at offset %d", keyLen, indexEntry.FileName, offset)
+			file.Close()
+			continue
+		}
 
 		keyBytes := make([]byte, keyLen)
 		file.Read(keyBytes)
+
+		if valueLen == tombstoneValueLen {
+			// A tombstone shadows every older version of this key; there is
+			// nothing left to read from earlier offsets.
+			file.Close()
+			return nil, ErrKeyNotFound
+		}
+
+		if expiry != 0 && expiry <= time.Now().UnixNano() {
+			file.Close()
+			return nil, ErrKeyExpired
+		}
+
+		if valueLen < 0 || valueLen > maxValueLen {
+			log.Printf("Value length %d out of bounds in %s at offset %d", valueLen, indexEntry.FileName, offset)
+			file.Close()
+			continue
+		}
+
 		valueBytes := make([]byte, valueLen)
 		file.Read(valueBytes)
 
-		calculatedCRC := calculateCRC(string(keyBytes) + string(valueBytes))
+		calculatedCRC := calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes)
 		if calculatedCRC != CRC {
 			log.Println("CRC mismatch detected")
 			file.Close()
@@ -162,66 +543,2258 @@ func (bc *Bitcask) Get(key string) ([]string, bool) {
 		file.Close()
 	}
 
-	return values, len(values) > 0
+	if len(values) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	return values, nil
 }
 
-// calculateCRC calculates a checksum for a string
-func calculateCRC(data string) int32 {
-	var crc int32
-	for _, c := range data {
-		crc += int32(c)
+// PutStream stores the bytes read from r under key as a sequence of
+// chunkSize fragment records, so arbitrarily large values never need to be
+// held in memory all at once. The key is looked up afterwards with
+// GetStream, not Get.
+func (bc *Bitcask) PutStream(key string, r io.Reader) error {
+	var chunks []ChunkLocation
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			fileName, offset, werr := bc.writeChunkFragment(key, buf[:n])
+			if werr != nil {
+				return werr
+			}
+			chunks = append(chunks, ChunkLocation{FileName: fileName, Offset: offset, Length: int64(n)})
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
 	}
-	return crc
+	return bc.writeChunkIndexRecord(key, chunks)
 }
 
-// HTTP Handlers
-func (bc *Bitcask) putHandler(w http.ResponseWriter, r *http.Request) {
-	type Request struct {
-		Key   string `json:"key"`
-		Value string `json:"value"`
+// GetStream returns a reader over a value written with PutStream. Each
+// fragment is read from disk only as the caller consumes it, instead of
+// buffering the whole value up front. It returns ErrKeyNotFound if the key
+// has no live entry, or ErrValueNotChunked if it was written with Put instead.
+func (bc *Bitcask) GetStream(key string) (io.ReadCloser, error) {
+	indexEntryInterface, exists := bc.index.Load(key)
+	if !exists {
+		return nil, ErrKeyNotFound
 	}
-	var req Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+	indexEntry := indexEntryInterface.(IndexEntry)
+	if !indexEntry.Chunked {
+		return nil, ErrValueNotChunked
 	}
+	return newChunkReader(indexEntry.Chunks), nil
+}
 
-	if err := bc.Put(req.Key, req.Value); err != nil {
-		http.Error(w, "Failed to store key-value", http.StatusInternalServerError)
-		return
+// chunkReader sequentially reads the fragments referenced by a chunk index
+// record, opening each backing segment file only when it's reached.
+type chunkReader struct {
+	chunks []ChunkLocation
+	next   int
+	file   *os.File
+	remain int64
+}
+
+func newChunkReader(chunks []ChunkLocation) *chunkReader {
+	return &chunkReader{chunks: chunks}
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if cr.file == nil {
+			if cr.next >= len(cr.chunks) {
+				return 0, io.EOF
+			}
+			chunk := cr.chunks[cr.next]
+			file, err := os.Open(chunk.FileName)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := file.Seek(chunk.Offset, os.SEEK_SET); err != nil {
+				file.Close()
+				return 0, err
+			}
+			cr.file = file
+			cr.remain = chunk.Length
+		}
+
+		if cr.remain <= 0 {
+			cr.file.Close()
+			cr.file = nil
+			cr.next++
+			continue
+		}
+
+		want := int64(len(p))
+		if want > cr.remain {
+			want = cr.remain
+		}
+		n, err := cr.file.Read(p[:want])
+		cr.remain -= int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		cr.file.Close()
+		cr.file = nil
+		cr.next++
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintln(w, "Key-Value stored successfully")
+// Close releases the fragment file chunkReader currently has open, if any.
+func (cr *chunkReader) Close() error {
+	if cr.file != nil {
+		return cr.file.Close()
+	}
+	return nil
 }
 
-func (bc *Bitcask) getHandler(w http.ResponseWriter, r *http.Request) {
-	key := r.URL.Query().Get("key")
-	if key == "" {
-		http.Error(w, "Missing key parameter", http.StatusBadRequest)
-		return
+// recordExpiry reads just the header of the record at offset in fileName
+// and returns its expiry, without reading the (possibly large) value.
+func recordExpiry(fileName string, offset int64) (int64, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return 0, err
 	}
+	defer file.Close()
 
-	values, found := bc.Get(key)
-	if !found {
-		http.Error(w, "Key not found", http.StatusNotFound)
-		return
+	if _, err := file.Seek(offset, os.SEEK_SET); err != nil {
+		return 0, err
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(values)
+	var CRC uint32
+	var timestamp int64
+	var keyLen, valueLen int32
+	var expiry int64
+	binary.Read(file, binary.LittleEndian, &CRC)
+	binary.Read(file, binary.LittleEndian, &timestamp)
+	binary.Read(file, binary.LittleEndian, &keyLen)
+	binary.Read(file, binary.LittleEndian, &valueLen)
+	if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+		return 0, err
+	}
+	return expiry, nil
 }
 
-func main() {
-	// Initialize Bitcask store
-	store, err := NewBitcask("data/", 1024*900) // 300 KB max file size
+// recordMeta reads just the header of the record at offset in fileName and
+// returns its write timestamp, its stored CRC, and its total on-disk length
+// (header + key + value), without reading the key or value bytes
+// themselves. It backs indexSnapshot, which needs enough to describe a
+// record to a peer without reading the whole thing.
+func recordMeta(fileName string, offset int64) (timestamp int64, crc uint32, size int64, err error) {
+	file, err := os.Open(fileName)
 	if err != nil {
-		log.Fatalf("Error initializing Bitcask: %v", err)
+		return 0, 0, 0, err
+	}
+	defer file.Close()
+
+	if _, err = file.Seek(offset, os.SEEK_SET); err != nil {
+		return 0, 0, 0, err
+	}
+
+	var keyLen, valueLen int32
+	var expiry int64
+	var kind byte
+	binary.Read(file, binary.LittleEndian, &crc)
+	binary.Read(file, binary.LittleEndian, &timestamp)
+	binary.Read(file, binary.LittleEndian, &keyLen)
+	binary.Read(file, binary.LittleEndian, &valueLen)
+	binary.Read(file, binary.LittleEndian, &expiry)
+	if err = binary.Read(file, binary.LittleEndian, &kind); err != nil {
+		return 0, 0, 0, err
+	}
+
+	size = int64(recordHeaderSize) + int64(keyLen)
+	if valueLen != tombstoneValueLen {
+		size += int64(valueLen)
+	}
+	return timestamp, crc, size, nil
+}
+
+// startExpirySweeper launches a goroutine that periodically scans the index
+// for expired keys and deletes them, turning their latest record into a
+// tombstone so Merge can reclaim the space.
+func (bc *Bitcask) startExpirySweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			bc.sweepExpired()
+		}
+	}()
+}
+
+// sweepExpired deletes every key in the index whose latest record has
+// expired.
+func (bc *Bitcask) sweepExpired() {
+	now := time.Now().UnixNano()
+
+	var expiredKeys []string
+	bc.index.Range(func(k, v interface{}) bool {
+		entry := v.(IndexEntry)
+		if len(entry.Offsets) == 0 {
+			return true
+		}
+
+		latestOffset := entry.Offsets[len(entry.Offsets)-1]
+		expiry, err := recordExpiry(entry.FileName, latestOffset)
+		if err != nil {
+			log.Printf("Error reading expiry for key %s: %v", k.(string), err)
+			return true
+		}
+		if expiry != 0 && expiry <= now {
+			expiredKeys = append(expiredKeys, k.(string))
+		}
+		return true
+	})
+
+	for _, key := range expiredKeys {
+		if err := bc.Delete(key); err != nil {
+			log.Printf("Error evicting expired key %s: %v", key, err)
+		}
+	}
+}
+
+// segmentInfo identifies a segment data file and when it was last written,
+// used to recover and merge segments in the order they were created.
+type segmentInfo struct {
+	name    string
+	path    string
+	modTime time.Time
+}
+
+// listSegmentFiles returns every segment data file in dataDir (including
+// the active one), oldest first.
+func (bc *Bitcask) listSegmentFiles() ([]segmentInfo, error) {
+	entries, err := os.ReadDir(bc.dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []segmentInfo
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".log" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segmentInfo{
+			name:    entry.Name(),
+			path:    filepath.Join(bc.dataDir, entry.Name()),
+			modTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].modTime.Equal(segments[j].modTime) {
+			// "segment.log" is the first segment ever created; rotated
+			// segments are named after their creation time.
+			if segments[i].name == "segment.log" || segments[j].name == "segment.log" {
+				return segments[i].name == "segment.log"
+			}
+			return segments[i].name < segments[j].name
+		}
+		return segments[i].modTime.Before(segments[j].modTime)
+	})
+	return segments, nil
+}
+
+// segmentFiles returns the non-active segment files in dataDir, oldest
+// first, excluding the currently active file.
+func (bc *Bitcask) segmentFiles() ([]string, error) {
+	all, err := bc.listSegmentFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	activeName := filepath.Base(bc.currentFile.Name())
+
+	var files []string
+	for _, seg := range all {
+		if seg.name == activeName {
+			continue
+		}
+		files = append(files, seg.name)
+	}
+	return files, nil
+}
+
+// recover rebuilds the in-memory index from every segment file on disk, in
+// the order the segments were created, then records the active file's
+// current size so rotation decisions stay correct across restarts. Before
+// scanning, it migrates any segment in an older format to the current v4
+// format.
+func (bc *Bitcask) recover() error {
+	segments, err := bc.listSegmentFiles()
+	if err != nil {
+		return err
+	}
+
+	activePath := bc.currentFile.Name()
+	for _, seg := range segments {
+		if err := bc.migrateSegment(seg.path, seg.path == activePath); err != nil {
+			return err
+		}
+	}
+
+	for _, seg := range segments {
+		if err := bc.recoverSegment(seg); err != nil {
+			return err
+		}
+	}
+
+	if info, err := bc.currentFile.Stat(); err == nil {
+		bc.currentFileSize = info.Size()
+	}
+
+	// Records already in a resumed active file are not in pendingHints, so a
+	// hint file written for it at rotation would miss them; force a full scan
+	// of it on the next recovery instead.
+	if bc.currentFileSize > 1 {
+		bc.hintsIncomplete = true
+	}
+
+	return nil
+}
+
+// migrateSegment ensures path starts with the current segment version byte,
+// stepping it forward one version at a time: a v0 segment (no version byte,
+// no expiry field) is rewritten as v1, a v1 segment (no kind byte) is
+// rewritten as v2, a v2 segment (additive CRC) is rewritten as v3, and a v3
+// segment (CRC excludes expiry/kind) is rewritten as v4. A brand new empty
+// file just gets the current version written to it.
+func (bc *Bitcask) migrateSegment(path string, isActive bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() == 0 {
+		if isActive {
+			_, err := bc.currentFile.Write([]byte{segmentVersionV4})
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = file.Write([]byte{segmentVersionV4})
+		return err
 	}
 
+	for {
+		version, err := readFirstByte(path)
+		if err != nil {
+			return err
+		}
+		switch version {
+		case segmentVersionV4:
+			return nil
+		case segmentVersionV3:
+			if err := bc.migrateV3Segment(path, isActive); err != nil {
+				return err
+			}
+		case segmentVersionV2:
+			if err := bc.migrateV2Segment(path, isActive); err != nil {
+				return err
+			}
+		case segmentVersionV1:
+			if err := bc.migrateV1Segment(path, isActive); err != nil {
+				return err
+			}
+		default:
+			if err := bc.migrateV0Segment(path, isActive); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// readFirstByte returns the first byte of path.
+func readFirstByte(path string) (byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var b [1]byte
+	if _, err := file.Read(b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// migrateSegmentRecords rewrites path one record at a time into a new file
+// stamped with newVersion, replacing path atomically when done. next reads
+// one record from src in whatever format path is currently in and returns
+// its re-encoded bytes in the new format, or ok=false at end of file or at
+// the first corrupt or truncated record — the only part that actually differs
+// between migration steps. skipVersionByte is true for every format except
+// v0, which predates the version-byte prefix entirely.
+func (bc *Bitcask) migrateSegmentRecords(path string, isActive bool, skipVersionByte bool, newVersion byte, next func(src io.Reader) ([]byte, bool)) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	if skipVersionByte {
+		var srcVersion [1]byte
+		if _, err := io.ReadFull(src, srcVersion[:]); err != nil {
+			return err
+		}
+	}
+
+	tmpPath := path + ".migrate"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := dst.Write([]byte{newVersion}); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for {
+		record, ok := next(src)
+		if !ok {
+			break
+		}
+		if _, err := dst.Write(record); err != nil {
+			dst.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if isActive {
+		if err := bc.currentFile.Close(); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	if isActive {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
+		bc.currentFile = file
+	}
+
+	return nil
+}
+
+// migrateV0Segment rewrites a legacy v0 segment (no version byte, no
+// expiry field) into the v1 format, preserving every record's CRC,
+// timestamp, key and value and setting expiry=0. It stops at the first
+// corrupt or truncated record, the same as scanSegment would.
+func (bc *Bitcask) migrateV0Segment(path string, isActive bool) error {
+	return bc.migrateSegmentRecords(path, isActive, false, segmentVersionV1, func(src io.Reader) ([]byte, bool) {
+		var CRC int32
+		var timestamp int64
+		var keyLen, valueLen int32
+		if binary.Read(src, binary.LittleEndian, &CRC) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &timestamp) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &keyLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &valueLen) != nil {
+			return nil, false
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			return nil, false
+		}
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(src, keyBytes); err != nil {
+			return nil, false
+		}
+
+		tombstone := valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				return nil, false
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(src, valueBytes); err != nil {
+				return nil, false
+			}
+		}
+
+		var additiveCRC int32
+		for _, c := range string(keyBytes) + string(valueBytes) {
+			additiveCRC += int32(c)
+		}
+		if additiveCRC != CRC {
+			return nil, false
+		}
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, CRC)
+		binary.Write(&buffer, binary.LittleEndian, timestamp)
+		binary.Write(&buffer, binary.LittleEndian, keyLen)
+		binary.Write(&buffer, binary.LittleEndian, valueLen)
+		binary.Write(&buffer, binary.LittleEndian, int64(0)) // v0 records never expire
+		buffer.Write(keyBytes)
+		if !tombstone {
+			buffer.Write(valueBytes)
+		}
+		return buffer.Bytes(), true
+	})
+}
+
+// migrateV1Segment rewrites a v1 segment (has an expiry field, but no kind
+// byte) into the v2 format, giving every existing record
+// recordKindPut since chunked values didn't exist before v2. It stops at the
+// first corrupt or truncated record, the same as scanSegment would.
+func (bc *Bitcask) migrateV1Segment(path string, isActive bool) error {
+	return bc.migrateSegmentRecords(path, isActive, true, segmentVersionV2, func(src io.Reader) ([]byte, bool) {
+		var CRC int32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		if binary.Read(src, binary.LittleEndian, &CRC) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &timestamp) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &keyLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &valueLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &expiry) != nil {
+			return nil, false
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			return nil, false
+		}
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(src, keyBytes); err != nil {
+			return nil, false
+		}
+
+		tombstone := valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				return nil, false
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(src, valueBytes); err != nil {
+				return nil, false
+			}
+		}
+
+		var additiveCRC int32
+		for _, c := range string(keyBytes) + string(valueBytes) {
+			additiveCRC += int32(c)
+		}
+		if additiveCRC != CRC {
+			return nil, false
+		}
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, CRC)
+		binary.Write(&buffer, binary.LittleEndian, timestamp)
+		binary.Write(&buffer, binary.LittleEndian, keyLen)
+		binary.Write(&buffer, binary.LittleEndian, valueLen)
+		binary.Write(&buffer, binary.LittleEndian, expiry)
+		buffer.WriteByte(recordKindPut) // v1 records predate chunking
+		buffer.Write(keyBytes)
+		if !tombstone {
+			buffer.Write(valueBytes)
+		}
+		return buffer.Bytes(), true
+	})
+}
+
+// migrateV2Segment rewrites a v2 segment (additive, easily-collided CRC)
+// into the v3 format by recomputing every record's CRC-32/IEEE over
+// timestamp/keyLen/valueLen/key/value — v3's CRC doesn't yet cover
+// expiry/kind, so it's computed directly here rather than via calculateCRC,
+// which folds both fields in for v4. Every other field is copied through
+// unchanged. It stops at the first corrupt or truncated record, the same as
+// scanSegment would.
+func (bc *Bitcask) migrateV2Segment(path string, isActive bool) error {
+	return bc.migrateSegmentRecords(path, isActive, true, segmentVersionV3, func(src io.Reader) ([]byte, bool) {
+		var oldCRC int32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
+		if binary.Read(src, binary.LittleEndian, &oldCRC) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &timestamp) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &keyLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &valueLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &expiry) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &kind) != nil {
+			return nil, false
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			return nil, false
+		}
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(src, keyBytes); err != nil {
+			return nil, false
+		}
+
+		tombstone := kind == recordKindPut && valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				return nil, false
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(src, valueBytes); err != nil {
+				return nil, false
+			}
+		}
+
+		var additiveCRC int32
+		for _, c := range string(keyBytes) + string(valueBytes) {
+			additiveCRC += int32(c)
+		}
+		if additiveCRC != oldCRC {
+			return nil, false
+		}
+
+		var crcBuffer bytes.Buffer
+		binary.Write(&crcBuffer, binary.LittleEndian, timestamp)
+		binary.Write(&crcBuffer, binary.LittleEndian, keyLen)
+		binary.Write(&crcBuffer, binary.LittleEndian, valueLen)
+		crcBuffer.Write(keyBytes)
+		if !tombstone {
+			crcBuffer.Write(valueBytes)
+		}
+		newCRC := crc32.ChecksumIEEE(crcBuffer.Bytes())
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, newCRC)
+		binary.Write(&buffer, binary.LittleEndian, timestamp)
+		binary.Write(&buffer, binary.LittleEndian, keyLen)
+		binary.Write(&buffer, binary.LittleEndian, valueLen)
+		binary.Write(&buffer, binary.LittleEndian, expiry)
+		buffer.WriteByte(kind)
+		buffer.Write(keyBytes)
+		if !tombstone {
+			buffer.Write(valueBytes)
+		}
+		return buffer.Bytes(), true
+	})
+}
+
+// migrateV3Segment rewrites a v3 segment (CRC excludes expiry and kind) into
+// the current v4 format by recomputing every record's CRC with calculateCRC,
+// which now folds both fields in. Every other field is copied through
+// unchanged. It stops at the first corrupt or truncated record, the same as
+// scanSegment would.
+func (bc *Bitcask) migrateV3Segment(path string, isActive bool) error {
+	return bc.migrateSegmentRecords(path, isActive, true, segmentVersionV4, func(src io.Reader) ([]byte, bool) {
+		var oldCRC int32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
+		if binary.Read(src, binary.LittleEndian, &oldCRC) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &timestamp) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &keyLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &valueLen) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &expiry) != nil {
+			return nil, false
+		}
+		if binary.Read(src, binary.LittleEndian, &kind) != nil {
+			return nil, false
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			return nil, false
+		}
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(src, keyBytes); err != nil {
+			return nil, false
+		}
+
+		tombstone := kind == recordKindPut && valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				return nil, false
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(src, valueBytes); err != nil {
+				return nil, false
+			}
+		}
+
+		var v3Buffer bytes.Buffer
+		binary.Write(&v3Buffer, binary.LittleEndian, timestamp)
+		binary.Write(&v3Buffer, binary.LittleEndian, keyLen)
+		binary.Write(&v3Buffer, binary.LittleEndian, valueLen)
+		v3Buffer.Write(keyBytes)
+		v3Buffer.Write(valueBytes)
+		if crc32.ChecksumIEEE(v3Buffer.Bytes()) != uint32(oldCRC) {
+			return nil, false
+		}
+
+		newCRC := calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes)
+
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, newCRC)
+		binary.Write(&buffer, binary.LittleEndian, timestamp)
+		binary.Write(&buffer, binary.LittleEndian, keyLen)
+		binary.Write(&buffer, binary.LittleEndian, valueLen)
+		binary.Write(&buffer, binary.LittleEndian, expiry)
+		buffer.WriteByte(kind)
+		buffer.Write(keyBytes)
+		if !tombstone {
+			buffer.Write(valueBytes)
+		}
+		return buffer.Bytes(), true
+	})
+}
+
+// recoverSegment rebuilds the index entries contributed by one segment,
+// preferring its hint file when one covers the segment's full contents and
+// falling back to a CRC-validated scan of the data file otherwise.
+func (bc *Bitcask) recoverSegment(seg segmentInfo) error {
+	if bc.loadHintFile(seg) {
+		return nil
+	}
+	return bc.scanSegment(seg)
+}
+
+// loadHintFile replays seg's companion hint file into the index. It refuses
+// to trust a hint file older than the data file it describes, since that
+// means the data file was written to after the hint was captured (e.g. the
+// segment.log name being reused as the active file across restarts).
+func (bc *Bitcask) loadHintFile(seg segmentInfo) bool {
+	hintPath := hintPathFor(seg.path)
+	hintInfo, err := os.Stat(hintPath)
+	if err != nil {
+		return false
+	}
+	dataInfo, err := os.Stat(seg.path)
+	if err != nil || hintInfo.ModTime().Before(dataInfo.ModTime()) {
+		return false
+	}
+
+	file, err := os.Open(hintPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	for {
+		var keyLen int32
+		if err := binary.Read(file, binary.LittleEndian, &keyLen); err != nil {
+			break
+		}
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(file, keyBytes); err != nil {
+			log.Printf("Truncated hint entry in %s, ignoring remainder", hintPath)
+			break
+		}
+		var valueLen int32
+		var offset, timestamp, expiry int64
+		if err := binary.Read(file, binary.LittleEndian, &valueLen); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &offset); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &timestamp); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+			break
+		}
+
+		key := string(keyBytes)
+		if expiry != 0 && expiry <= time.Now().UnixNano() {
+			// Already expired: behave as if a tombstone had been written,
+			// the same as scanSegment, rather than indexing it as live only
+			// for Get to reject it until the sweeper gets to it.
+			bc.index.Delete(key)
+			continue
+		}
+
+		bc.indexRecord(key, seg.path, offset, valueLen == tombstoneValueLen)
+	}
+
+	return true
+}
+
+// scanSegment sequentially reads and CRC-validates every record in seg's
+// data file, replaying live records into the index and applying tombstones
+// as deletions.
+// A corrupt or truncated tail record is logged and the file truncated to
+// the last good record instead of aborting startup.
+func (bc *Bitcask) scanSegment(seg segmentInfo) error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var versionByte [1]byte
+	if _, err := io.ReadFull(file, versionByte[:]); err != nil {
+		return nil // empty or unreadable segment: nothing to recover
+	}
+	offset := int64(1)
+
+	for {
+		recordStart := offset
+
+		var CRC uint32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
+		if err := binary.Read(file, binary.LittleEndian, &CRC); err != nil {
+			break // clean EOF between records
+		}
+		if err := binary.Read(file, binary.LittleEndian, &timestamp); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &keyLen); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &valueLen); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &kind); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			log.Printf("Key length %d out of bounds recovering %s at offset %d", keyLen, seg.path, recordStart)
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(file, keyBytes); err != nil {
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+
+		tombstone := kind == recordKindPut && valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				log.Printf("Value length %d out of bounds recovering %s at offset %d", valueLen, seg.path, recordStart)
+				bc.truncateCorrupt(seg.path, recordStart)
+				break
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(file, valueBytes); err != nil {
+				bc.truncateCorrupt(seg.path, recordStart)
+				break
+			}
+		}
+
+		key := string(keyBytes)
+		expectedCRC := calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes)
+		if expectedCRC != CRC {
+			log.Printf("CRC mismatch recovering %s at offset %d", seg.path, recordStart)
+			bc.truncateCorrupt(seg.path, recordStart)
+			break
+		}
+
+		recordLen := int64(recordHeaderSize + int(keyLen))
+		if !tombstone {
+			recordLen += int64(valueLen)
+		}
+		offset = recordStart + recordLen
+
+		switch kind {
+		case recordKindChunkFragment:
+			// Only reachable through its key's chunk index record; never
+			// indexed directly.
+			continue
+		case recordKindChunkIndex:
+			chunks, err := decodeChunkLocations(valueBytes)
+			if err != nil {
+				log.Printf("Corrupt chunk index recovering %s at offset %d: %v", seg.path, recordStart, err)
+				continue
+			}
+			bc.index.Store(key, IndexEntry{FileName: seg.path, Offsets: []int64{recordStart}, Chunked: true, Chunks: chunks})
+			continue
+		}
+
+		if expiry != 0 && expiry <= time.Now().UnixNano() {
+			// Already expired: behave as if a tombstone had been written,
+			// rather than adding it to the index only for Get to reject it.
+			bc.index.Delete(key)
+			continue
+		}
+
+		bc.indexRecord(key, seg.path, recordStart, tombstone)
+	}
+
+	return nil
+}
+
+// truncateCorrupt drops everything in path from offset at, so a corrupt or
+// partially-written tail record left by a crash doesn't linger on disk or
+// get reinterpreted on a later recovery pass.
+func (bc *Bitcask) truncateCorrupt(path string, at int64) {
+	log.Printf("Truncating %s at offset %d after corrupt or incomplete tail record", path, at)
+	if err := os.Truncate(path, at); err != nil {
+		log.Printf("Error truncating %s: %v", path, err)
+	}
+}
+
+// VerifyIssue describes a single corrupt or truncated record found by
+// Verify.
+type VerifyIssue struct {
+	FileName string
+	Offset   int64
+	Reason   string
+}
+
+// VerifyReport summarizes the outcome of a Verify scan across all segments.
+type VerifyReport struct {
+	GoodRecords      int
+	CorruptRecords   int
+	TruncatedRecords int
+	Issues           []VerifyIssue
+}
+
+// Verify scans every segment file end-to-end, recomputing each record's CRC
+// and validating its key/value length bounds, without mutating the index or
+// truncating anything on disk. It is a read-only diagnostic for operators,
+// the recovery-tool-style surface referenced by the /verify handler.
+func (bc *Bitcask) Verify() (VerifyReport, error) {
+	segments, err := bc.listSegmentFiles()
+	if err != nil {
+		return VerifyReport{}, err
+	}
+
+	var report VerifyReport
+	for _, seg := range segments {
+		if err := bc.verifySegment(seg, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// verifySegment appends the findings for a single segment to report. Unlike
+// scanSegment, it never mutates the index or truncates the file: a corrupt
+// or truncated record simply ends the scan of that segment, since the
+// correct resync offset beyond it isn't known.
+func (bc *Bitcask) verifySegment(seg segmentInfo, report *VerifyReport) error {
+	file, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var versionByte [1]byte
+	if _, err := io.ReadFull(file, versionByte[:]); err != nil {
+		return nil // empty or unreadable segment: nothing to verify
+	}
+	offset := int64(1)
+
+	for {
+		recordStart := offset
+
+		var CRC uint32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
+		if err := binary.Read(file, binary.LittleEndian, &CRC); err != nil {
+			break // clean EOF between records
+		}
+		if err := binary.Read(file, binary.LittleEndian, &timestamp); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated record header"})
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &keyLen); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated record header"})
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &valueLen); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated record header"})
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated record header"})
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &kind); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated record header"})
+			break
+		}
+
+		if keyLen < 0 || keyLen > maxKeyLen {
+			report.CorruptRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: fmt.Sprintf("key length %d out of bounds", keyLen)})
+			break
+		}
+
+		keyBytes := make([]byte, keyLen)
+		if _, err := io.ReadFull(file, keyBytes); err != nil {
+			report.TruncatedRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated key"})
+			break
+		}
+
+		tombstone := kind == recordKindPut && valueLen == tombstoneValueLen
+		var valueBytes []byte
+		if !tombstone {
+			if valueLen < 0 || valueLen > maxValueLen {
+				report.CorruptRecords++
+				report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: fmt.Sprintf("value length %d out of bounds", valueLen)})
+				break
+			}
+			valueBytes = make([]byte, valueLen)
+			if _, err := io.ReadFull(file, valueBytes); err != nil {
+				report.TruncatedRecords++
+				report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "truncated value"})
+				break
+			}
+		}
+
+		expectedCRC := calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes)
+		if expectedCRC != CRC {
+			report.CorruptRecords++
+			report.Issues = append(report.Issues, VerifyIssue{FileName: seg.name, Offset: recordStart, Reason: "CRC mismatch"})
+			break
+		}
+
+		report.GoodRecords++
+
+		recordLen := int64(recordHeaderSize + int(keyLen))
+		if !tombstone {
+			recordLen += int64(valueLen)
+		}
+		offset = recordStart + recordLen
+	}
+
+	return nil
+}
+
+// mergedRecord is the latest surviving version of a key found while
+// scanning the immutable segment files.
+type mergedRecord struct {
+	key       string
+	value     string
+	expiry    int64
+	timestamp int64
+}
+
+// Merge compacts the non-active segment files into a single fresh segment,
+// keeping only the newest live version of each key and dropping tombstones
+// and the versions they shadow. It then atomically swaps the new segment
+// in, repoints the index at it, and unlinks the obsolete segments. A
+// segment holding any chunk fragment or chunk index record is not compacted
+// and stays as it is.
+func (bc *Bitcask) Merge() error {
+	bc.activeFileMu.Lock()
+	segments, err := bc.segmentFiles()
+	bc.activeFileMu.Unlock()
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return nil
+	}
+
+	var compactable []string
+	for _, name := range segments {
+		hasChunks, err := bc.segmentHasChunkRecords(filepath.Join(bc.dataDir, name))
+		if err != nil {
+			return err
+		}
+		if hasChunks {
+			// Streamed values live here; Merge doesn't yet compact chunked
+			// segments, so leave this one alone rather than risk losing the
+			// fragments a chunk index record in it points to.
+			continue
+		}
+		compactable = append(compactable, name)
+	}
+	if len(compactable) == 0 {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	latest := make(map[string]mergedRecord)
+	order := []string{}
+
+	for _, name := range compactable {
+		path := filepath.Join(bc.dataDir, name)
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+
+		var versionByte [1]byte
+		if _, err := io.ReadFull(file, versionByte[:]); err != nil {
+			file.Close()
+			continue
+		}
+
+		for {
+			var CRC uint32
+			var timestamp int64
+			var keyLen, valueLen int32
+			var expiry int64
+			var kind byte
+			if err := binary.Read(file, binary.LittleEndian, &CRC); err != nil {
+				break
+			}
+			if err := binary.Read(file, binary.LittleEndian, &timestamp); err != nil {
+				break
+			}
+			if err := binary.Read(file, binary.LittleEndian, &keyLen); err != nil {
+				break
+			}
+			if err := binary.Read(file, binary.LittleEndian, &valueLen); err != nil {
+				break
+			}
+			if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+				break
+			}
+			if err := binary.Read(file, binary.LittleEndian, &kind); err != nil {
+				break
+			}
+
+			if keyLen < 0 || keyLen > maxKeyLen {
+				log.Printf("Merge: key length %d out of bounds in %s, stopping scan of this segment", keyLen, path)
+				break
+			}
+			keyBytes := make([]byte, keyLen)
+			if _, err := io.ReadFull(file, keyBytes); err != nil {
+				break
+			}
+			key := string(keyBytes)
+
+			tombstone := valueLen == tombstoneValueLen
+			var valueBytes []byte
+			if !tombstone {
+				if valueLen < 0 || valueLen > maxValueLen {
+					log.Printf("Merge: value length %d out of bounds in %s, stopping scan of this segment", valueLen, path)
+					break
+				}
+				valueBytes = make([]byte, valueLen)
+				if _, err := io.ReadFull(file, valueBytes); err != nil {
+					break
+				}
+			}
+
+			if calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes) != CRC {
+				log.Printf("Merge: CRC mismatch in %s for key %q, stopping scan of this segment", path, key)
+				break
+			}
+
+			if tombstone {
+				if _, ok := latest[key]; !ok {
+					order = append(order, key)
+				}
+				delete(latest, key)
+				continue
+			}
+
+			if expiry != 0 && expiry <= now {
+				// Already expired: drop it the same as a tombstone instead
+				// of waiting for the sweeper to get to it first.
+				if _, ok := latest[key]; !ok {
+					order = append(order, key)
+				}
+				delete(latest, key)
+				continue
+			}
+
+			if _, ok := latest[key]; !ok {
+				order = append(order, key)
+			}
+			latest[key] = mergedRecord{key: key, value: string(valueBytes), expiry: expiry, timestamp: timestamp}
+		}
+
+		file.Close()
+	}
+
+	// compactableSet lets the repoint loop below tell whether a key's live
+	// index entry still points into one of the segments Merge just
+	// compacted. indexRecord always keeps a key's FileName/Offsets
+	// pointing into a single file, so any Put or Delete that has landed
+	// since Merge started reading these segments moves the key's entry to
+	// a file outside this set (the active file, or one rotated to since) —
+	// there is no window in which a concurrent write keeps pointing at a
+	// compacted segment.
+	compactableSet := make(map[string]bool, len(compactable))
+	for _, name := range compactable {
+		compactableSet[name] = true
+	}
+
+	mergedFileName := fmt.Sprintf("segment-merged-%d.log", time.Now().UnixMicro())
+	mergedPath := filepath.Join(bc.dataDir, mergedFileName)
+	tmpPath := mergedPath + ".tmp"
+
+	mergedFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := mergedFile.Write([]byte{segmentVersionV4}); err != nil {
+		mergedFile.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	newOffsets := make(map[string]int64, len(latest))
+	var hints []hintEntry
+	offset := int64(1)
+	for _, key := range order {
+		record, ok := latest[key]
+		if !ok {
+			continue
+		}
+
+		timestamp := record.timestamp
+		keyLen := int32(len(record.key))
+		valueLen := int32(len(record.value))
+		CRC := calculateCRC(timestamp, keyLen, valueLen, record.expiry, recordKindPut, []byte(record.key), []byte(record.value))
+		var buffer bytes.Buffer
+		binary.Write(&buffer, binary.LittleEndian, CRC)
+		binary.Write(&buffer, binary.LittleEndian, timestamp)
+		binary.Write(&buffer, binary.LittleEndian, keyLen)
+		binary.Write(&buffer, binary.LittleEndian, valueLen)
+		binary.Write(&buffer, binary.LittleEndian, record.expiry)
+		buffer.WriteByte(recordKindPut)
+		buffer.WriteString(record.key)
+		buffer.WriteString(record.value)
+		data := buffer.Bytes()
+
+		if _, err := mergedFile.Write(data); err != nil {
+			mergedFile.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+
+		newOffsets[key] = offset
+		hints = append(hints, hintEntry{Key: record.key, ValueLen: int32(len(record.value)), Offset: offset, Timestamp: timestamp, Expiry: record.expiry})
+		offset += int64(len(data))
+	}
+
+	if err := mergedFile.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, mergedPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := bc.writeHintFile(mergedPath, hints); err != nil {
+		log.Printf("Error writing hint file for %s: %v", mergedPath, err)
+	}
+
+	// Repoint the index at the merged segment for every key we rewrote, but
+	// only if the live entry still points into one of the segments we just
+	// compacted. A concurrent Put or Delete landing any time from when
+	// Merge started reading these segments onward moves the key's entry to
+	// a file outside compactableSet; that entry already reflects the newer
+	// write, so repointing it here would clobber it back to the stale
+	// pre-merge value (or, for a Delete, resurrect a tombstoned key) —
+	// leave those alone instead.
+	for key, off := range newOffsets {
+		current, ok := bc.index.Load(key)
+		if !ok {
+			continue
+		}
+		entry := current.(IndexEntry)
+		if entry.Chunked || !compactableSet[filepath.Base(entry.FileName)] {
+			continue
+		}
+		bc.index.Store(key, IndexEntry{FileName: mergedPath, Offsets: []int64{off}})
+	}
+
+	for _, name := range compactable {
+		segPath := filepath.Join(bc.dataDir, name)
+		if err := os.Remove(segPath); err != nil {
+			log.Printf("Error removing obsolete segment %s: %v", name, err)
+		}
+		if err := os.Remove(hintPathFor(segPath)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing obsolete hint file for %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// segmentHasChunkRecords reports whether path contains any chunk fragment or
+// chunk index record, without reading value bytes. Merge uses this to leave
+// a segment alone entirely rather than compact it, since it doesn't yet know
+// how to safely rewrite or relocate streamed values.
+func (bc *Bitcask) segmentHasChunkRecords(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	var versionByte [1]byte
+	if _, err := io.ReadFull(file, versionByte[:]); err != nil {
+		return false, nil
+	}
+
+	for {
+		var CRC uint32
+		var timestamp int64
+		var keyLen, valueLen int32
+		var expiry int64
+		var kind byte
+		if err := binary.Read(file, binary.LittleEndian, &CRC); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &timestamp); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &keyLen); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &valueLen); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &expiry); err != nil {
+			break
+		}
+		if err := binary.Read(file, binary.LittleEndian, &kind); err != nil {
+			break
+		}
+		if kind != recordKindPut {
+			return true, nil
+		}
+
+		skip := int64(keyLen)
+		if valueLen != tombstoneValueLen {
+			skip += int64(valueLen)
+		}
+		if _, err := file.Seek(skip, os.SEEK_CUR); err != nil {
+			break
+		}
+	}
+	return false, nil
+}
+
+// calculateCRC computes a CRC-32/IEEE checksum over a record's full header
+// and payload, in on-disk order: timestamp, keyLen, valueLen, expiry, kind,
+// key and value. Covering expiry and kind means a header corrupted in
+// either field is caught as a CRC mismatch instead of being misinterpreted
+// (e.g. a flipped kind byte silently dropping a live key from the index).
+func calculateCRC(timestamp int64, keyLen, valueLen int32, expiry int64, kind byte, key, value []byte) uint32 {
+	var buffer bytes.Buffer
+	binary.Write(&buffer, binary.LittleEndian, timestamp)
+	binary.Write(&buffer, binary.LittleEndian, keyLen)
+	binary.Write(&buffer, binary.LittleEndian, valueLen)
+	binary.Write(&buffer, binary.LittleEndian, expiry)
+	buffer.WriteByte(kind)
+	buffer.Write(key)
+	buffer.Write(value)
+	return crc32.ChecksumIEEE(buffer.Bytes())
+}
+
+// Replication
+//
+// A Replicator turns a single-node Bitcask into one member of a cluster. On
+// every successful Put/Delete it publishes the raw framed record (as
+// written by writeFramedRecord) to configured peers over a length-prefixed
+// TCP protocol; a peer appends the bytes verbatim to its own active segment
+// and applies them to its own index, the same way recoverSegment would. A
+// Replicator can host several independent repos (keyspaces) at once, each a
+// separate *Bitcask Registered under its own name, so one server process
+// can serve more than one cluster.
+//
+// A node joining late catches up with Join: it asks a peer for an Index
+// snapshot of everything written since a given time, then Requests and
+// applies the raw bytes for whatever it's missing, mirroring the
+// index/announce-then-request pattern used by block-sync protocols such as
+// syncthing's.
+//
+// Replication only covers Put/Delete; PutStream's chunk fragments and
+// chunk index record are not published or included in Index snapshots, so
+// a value written with PutStream is not replicated to peers.
+
+// replication message kinds, the first byte of every frame's payload.
+const (
+	msgKindPublish       byte = 1
+	msgKindIndexRequest  byte = 2
+	msgKindIndexResponse byte = 3
+	msgKindBlockRequest  byte = 4
+	msgKindBlockResponse byte = 5
+)
+
+// writeFrame writes one length-prefixed replication message: a 4-byte
+// little-endian length covering the kind byte and the JSON-encoded payload
+// that follow it.
+func writeFrame(w io.Writer, kind byte, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if len(body)+1 > maxReplicationMessageSize {
+		return fmt.Errorf("bitcask: replication message of %d bytes exceeds the %d byte limit", len(body)+1, maxReplicationMessageSize)
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(body)+1)); err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte{kind}); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// readFrame reads one length-prefixed replication message and returns its
+// kind and the raw JSON payload bytes that follow it.
+func readFrame(r io.Reader) (byte, []byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	if length == 0 || length > maxReplicationMessageSize {
+		return 0, nil, fmt.Errorf("bitcask: replication message length %d out of bounds", length)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, nil, err
+	}
+	return buf[0], buf[1:], nil
+}
+
+// publishMessage is sent fire-and-forget to every peer after a successful
+// Put/Delete: the raw framed record plus enough to place it (repo, key, and
+// the segment name and offset it landed at on the originating node).
+type publishMessage struct {
+	Repo     string
+	Key      string
+	FileName string
+	Offset   int64
+	Data     []byte
+}
+
+// indexRequestMessage asks a peer for a snapshot of everything it has
+// written to repo at or after since.
+type indexRequestMessage struct {
+	Repo  string
+	Since int64 // unix seconds; zero means from the beginning
+}
+
+// IndexEntrySnapshot is one row of an Index catch-up response: a key's
+// current location on the responding peer, when it was last written, and
+// enough of its framing (Size, CRC) for Request to fetch and verify the
+// raw bytes without the caller needing to read them first.
+type IndexEntrySnapshot struct {
+	Key       string
+	FileName  string
+	Offset    int64
+	Timestamp int64
+	Size      uint32
+	CRC       uint32
+}
+
+type indexResponseMessage struct {
+	Entries []IndexEntrySnapshot
+}
+
+// blockRequestMessage asks a peer for the size raw bytes at offset in the
+// segment that currently holds key in repo, verifying them against crc
+// before use.
+type blockRequestMessage struct {
+	Repo   string
+	Key    string
+	Offset int64
+	Size   uint32
+	CRC    uint32
+}
+
+type blockResponseMessage struct {
+	Data []byte
+	Err  string
+}
+
+// Replicator is the replication hub for a server process: it accepts peer
+// connections, publishes each registered repo's Put/Delete records to
+// configured peers, and serves Index/Request catch-up calls from joining
+// peers.
+type Replicator struct {
+	mu    sync.RWMutex
+	repos map[string]*Bitcask
+	peers []string
+}
+
+// NewReplicator creates a Replicator that publishes to the given peer
+// addresses (host:port); repos are attached afterwards with Register.
+func NewReplicator(peers []string) *Replicator {
+	return &Replicator{
+		repos: make(map[string]*Bitcask),
+		peers: peers,
+	}
+}
+
+// Register attaches bc to rp under repo: bc's future Puts and Deletes are
+// published to rp's peers, and Index/Request calls naming repo are served
+// from bc.
+func (rp *Replicator) Register(repo string, bc *Bitcask) {
+	rp.mu.Lock()
+	rp.repos[repo] = bc
+	rp.mu.Unlock()
+	bc.repo = repo
+	bc.replicator = rp
+}
+
+// ListenAndServe accepts replication connections on addr and serves
+// Publish, Index, and Request messages against rp's registered repos until
+// the listener errors or is closed.
+func (rp *Replicator) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go rp.handleConn(conn)
+	}
+}
+
+// handleConn serves exactly one replication message on conn, mirroring the
+// request/publish-per-connection pattern peerClient dials with; a client
+// that wants another call opens a new connection.
+func (rp *Replicator) handleConn(conn net.Conn) {
+	defer conn.Close()
+
+	kind, payload, err := readFrame(conn)
+	if err != nil {
+		if err != io.EOF {
+			log.Printf("replication: reading message: %v", err)
+		}
+		return
+	}
+
+	switch kind {
+	case msgKindPublish:
+		rp.handlePublish(payload)
+	case msgKindIndexRequest:
+		rp.handleIndexRequest(conn, payload)
+	case msgKindBlockRequest:
+		rp.handleBlockRequest(conn, payload)
+	default:
+		log.Printf("replication: unknown message kind %d", kind)
+	}
+}
+
+func (rp *Replicator) handlePublish(payload []byte) {
+	var msg publishMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		log.Printf("replication: invalid publish message: %v", err)
+		return
+	}
+
+	rp.mu.RLock()
+	bc, ok := rp.repos[msg.Repo]
+	rp.mu.RUnlock()
+	if !ok {
+		log.Printf("replication: publish for unknown repo %q", msg.Repo)
+		return
+	}
+
+	if err := bc.applyReplicatedRecord(msg.Data); err != nil {
+		log.Printf("replication: applying record for key %q: %v", msg.Key, err)
+	}
+}
+
+func (rp *Replicator) handleIndexRequest(conn net.Conn, payload []byte) {
+	var req indexRequestMessage
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("replication: invalid index request: %v", err)
+		return
+	}
+
+	rp.mu.RLock()
+	bc, ok := rp.repos[req.Repo]
+	rp.mu.RUnlock()
+
+	var resp indexResponseMessage
+	if ok {
+		resp.Entries = bc.indexSnapshot(time.Unix(req.Since, 0))
+	}
+	if err := writeFrame(conn, msgKindIndexResponse, resp); err != nil {
+		log.Printf("replication: writing index response: %v", err)
+	}
+}
+
+func (rp *Replicator) handleBlockRequest(conn net.Conn, payload []byte) {
+	var req blockRequestMessage
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("replication: invalid block request: %v", err)
+		return
+	}
+
+	rp.mu.RLock()
+	bc, ok := rp.repos[req.Repo]
+	rp.mu.RUnlock()
+
+	var resp blockResponseMessage
+	if !ok {
+		resp.Err = fmt.Sprintf("bitcask: unknown repo %q", req.Repo)
+	} else if data, err := bc.readBlock(req.Key, req.Offset, req.Size, req.CRC); err != nil {
+		resp.Err = err.Error()
+	} else {
+		resp.Data = data
+	}
+	if err := writeFrame(conn, msgKindBlockResponse, resp); err != nil {
+		log.Printf("replication: writing block response: %v", err)
+	}
+}
+
+// Publish sends the raw framed record for key, written to fileName at
+// offset, to every configured peer. It is best-effort: a peer that is
+// unreachable is logged and skipped rather than retried, since Join exists
+// to repair exactly that kind of gap.
+func (rp *Replicator) Publish(repo, key, fileName string, offset int64, data []byte) {
+	msg := publishMessage{Repo: repo, Key: key, FileName: filepath.Base(fileName), Offset: offset, Data: data}
+
+	rp.mu.RLock()
+	peers := append([]string(nil), rp.peers...)
+	rp.mu.RUnlock()
+
+	// Peers are dialed concurrently: one slow or unreachable peer should
+	// cost at most one dial timeout, not one per peer.
+	var wg sync.WaitGroup
+	for _, addr := range peers {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", addr, replicationDialTimeout)
+			if err != nil {
+				log.Printf("replication: publish to %s: %v", addr, err)
+				return
+			}
+			defer conn.Close()
+			if err := writeFrame(conn, msgKindPublish, msg); err != nil {
+				log.Printf("replication: publish to %s: %v", addr, err)
+			}
+		}(addr)
+	}
+	wg.Wait()
+}
+
+// peerClient is a connection to one replication peer, dialed fresh for
+// each call; Publish likewise dials its own short-lived connections rather
+// than sharing one, since there is no response to wait for.
+type peerClient struct {
+	addr string
+}
+
+// Peer returns a client for addr, one of rp's configured peers, for use
+// during the bootstrap/catch-up phase driven by Join.
+func (rp *Replicator) Peer(addr string) *peerClient {
+	return &peerClient{addr: addr}
+}
+
+// Index requests a snapshot of every key repoID has written at or after
+// since, for a joining node to diff against its own index before pulling
+// whatever it's missing with Request.
+func (pc *peerClient) Index(repoID string, since time.Time) ([]IndexEntrySnapshot, error) {
+	conn, err := net.Dial("tcp", pc.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := indexRequestMessage{Repo: repoID, Since: since.Unix()}
+	if err := writeFrame(conn, msgKindIndexRequest, req); err != nil {
+		return nil, err
+	}
+
+	kind, payload, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if kind != msgKindIndexResponse {
+		return nil, fmt.Errorf("bitcask: unexpected reply kind %d to index request", kind)
+	}
+
+	var resp indexResponseMessage
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// Request pulls the size raw bytes at offset in repo's copy of key's
+// segment from the peer, verifying them against crc before returning them.
+func (pc *peerClient) Request(repo, key string, offset int64, size uint32, crc uint32) ([]byte, error) {
+	conn, err := net.Dial("tcp", pc.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	req := blockRequestMessage{Repo: repo, Key: key, Offset: offset, Size: size, CRC: crc}
+	if err := writeFrame(conn, msgKindBlockRequest, req); err != nil {
+		return nil, err
+	}
+
+	kind, payload, err := readFrame(conn)
+	if err != nil {
+		return nil, err
+	}
+	if kind != msgKindBlockResponse {
+		return nil, fmt.Errorf("bitcask: unexpected reply kind %d to block request", kind)
+	}
+
+	var resp blockResponseMessage
+	if err := json.Unmarshal(payload, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Err != "" {
+		return nil, errors.New(resp.Err)
+	}
+	return resp.Data, nil
+}
+
+// Join runs the bootstrap/catch-up phase for repo against peerAddr: it
+// fetches an Index snapshot of everything the peer has written since
+// since, then Requests and applies the raw bytes for every key repo
+// doesn't already have, so a newly started node converges on the peer's
+// state instead of relying on live Publish traffic to eventually cover it.
+func (rp *Replicator) Join(repo, peerAddr string, since time.Time) error {
+	rp.mu.RLock()
+	bc, ok := rp.repos[repo]
+	rp.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("bitcask: unknown repo %q", repo)
+	}
+
+	peer := rp.Peer(peerAddr)
+	entries, err := peer.Index(repo, since)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if !bc.needsCatchup(e) {
+			continue
+		}
+		data, err := peer.Request(repo, e.Key, e.Offset, e.Size, e.CRC)
+		if err != nil {
+			log.Printf("replication: requesting key %q from %s: %v", e.Key, peerAddr, err)
+			continue
+		}
+		if err := bc.applyReplicatedRecord(data); err != nil {
+			log.Printf("replication: applying catch-up record for key %q: %v", e.Key, err)
+		}
+	}
+	return nil
+}
+
+// needsCatchup reports whether bc either has no entry at all for e.Key or
+// its latest local copy is older than e, so Join pulls keys it's missing
+// entirely as well as ones it only has a stale version of.
+func (bc *Bitcask) needsCatchup(e IndexEntrySnapshot) bool {
+	entryIface, ok := bc.index.Load(e.Key)
+	if !ok {
+		return true
+	}
+	entry := entryIface.(IndexEntry)
+	if len(entry.Offsets) == 0 {
+		return true
+	}
+	// recordMeta reads a record's header generically, so this works
+	// whether the local copy is a plain put or (as for a Chunked entry) a
+	// chunk index record; either way a newer timestamp on the peer means
+	// bc's copy is stale.
+	localOffset := entry.Offsets[len(entry.Offsets)-1]
+	localTimestamp, _, _, err := recordMeta(entry.FileName, localOffset)
+	if err != nil {
+		return true
+	}
+	return localTimestamp < e.Timestamp
+}
+
+// applyReplicatedRecord appends a raw framed record received from a peer
+// (via Publish or Join) to the active segment verbatim and applies it to
+// the index, mirroring what writeFramedRecord does for a locally-originated
+// record without recomputing its CRC or re-deriving its framing.
+func (bc *Bitcask) applyReplicatedRecord(data []byte) error {
+	crc, timestamp, keyLen, valueLen, expiry, kind, err := decodeRecordHeader(data)
+	if err != nil {
+		return err
+	}
+
+	if keyLen < 0 || keyLen > maxKeyLen {
+		return fmt.Errorf("bitcask: replicated key length %d out of bounds", keyLen)
+	}
+	if int64(recordHeaderSize)+int64(keyLen) > int64(len(data)) {
+		return fmt.Errorf("bitcask: replicated record too short for key length %d", keyLen)
+	}
+	keyBytes := data[recordHeaderSize : recordHeaderSize+int(keyLen)]
+	key := string(keyBytes)
+
+	tombstone := valueLen == tombstoneValueLen
+	var valueBytes []byte
+	if !tombstone {
+		if valueLen < 0 || valueLen > maxValueLen {
+			return fmt.Errorf("bitcask: replicated value length %d out of bounds", valueLen)
+		}
+		if int64(recordHeaderSize)+int64(keyLen)+int64(valueLen) != int64(len(data)) {
+			return fmt.Errorf("bitcask: replicated record length mismatch for key %q", key)
+		}
+		valueBytes = data[recordHeaderSize+int(keyLen):]
+	}
+	if calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes) != crc {
+		return fmt.Errorf("bitcask: replicated record for key %q failed CRC check", key)
+	}
+
+	bc.activeFileMu.Lock()
+	offset, err := bc.currentFile.Seek(0, os.SEEK_END)
+	if err != nil {
+		bc.activeFileMu.Unlock()
+		return err
+	}
+	if _, err := bc.currentFile.Write(data); err != nil {
+		bc.activeFileMu.Unlock()
+		return err
+	}
+	fileName := bc.currentFile.Name()
+
+	if kind == recordKindPut {
+		bc.pendingHints = append(bc.pendingHints, hintEntry{Key: key, ValueLen: valueLen, Offset: offset, Timestamp: timestamp, Expiry: expiry})
+	} else {
+		bc.hintsIncomplete = true
+	}
+
+	bc.currentFileSize += int64(len(data))
+	if bc.currentFileSize > bc.maxFileSize {
+		err = bc.rotateFile()
+	}
+	bc.activeFileMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if kind != recordKindPut {
+		return nil
+	}
+
+	if !tombstone && expiry != 0 && expiry <= time.Now().UnixNano() {
+		bc.index.Delete(key)
+		return nil
+	}
+	bc.indexRecord(key, fileName, offset, tombstone)
+	return nil
+}
+
+// readBlock reads size raw bytes of key's record and verifies them against
+// crc, serving a peer's catch-up Request. offset is informational only: a
+// Merge running between the requester's Index call and this Request can
+// move key to a different file at a different offset, so readBlock always
+// reads from key's current index entry instead of trusting the caller's
+// now possibly-stale offset. That's safe because CRC is computed over the
+// record's logical content, which Merge preserves unchanged.
+func (bc *Bitcask) readBlock(key string, offset int64, size uint32, crc uint32) ([]byte, error) {
+	entryIface, ok := bc.index.Load(key)
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	entry := entryIface.(IndexEntry)
+	if len(entry.Offsets) == 0 {
+		return nil, ErrKeyNotFound
+	}
+	currentOffset := entry.Offsets[len(entry.Offsets)-1]
+
+	file, err := os.Open(entry.FileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(currentOffset, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, err
+	}
+
+	_, timestamp, keyLen, valueLen, expiry, kind, err := decodeRecordHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	keyBytes := data[recordHeaderSize : recordHeaderSize+int(keyLen)]
+	var valueBytes []byte
+	if valueLen != tombstoneValueLen {
+		valueBytes = data[recordHeaderSize+int(keyLen):]
+	}
+	// crc is the value stored in the record's own header (calculateCRC's
+	// checksum over the full header plus key/value), not a checksum over
+	// these raw framed bytes as a whole.
+	if calculateCRC(timestamp, keyLen, valueLen, expiry, kind, keyBytes, valueBytes) != crc {
+		return nil, fmt.Errorf("bitcask: block for key %q in %s failed CRC check", key, entry.FileName)
+	}
+	return data, nil
+}
+
+// decodeRecordHeader parses a record's fixed header — everything up to the
+// key bytes — from its raw framed bytes, as received over the replication
+// wire protocol or read back off a segment file.
+func decodeRecordHeader(data []byte) (crc uint32, timestamp int64, keyLen, valueLen int32, expiry int64, kind byte, err error) {
+	if len(data) < recordHeaderSize {
+		err = fmt.Errorf("bitcask: record shorter than header (%d bytes)", len(data))
+		return
+	}
+	r := bytes.NewReader(data)
+	binary.Read(r, binary.LittleEndian, &crc)
+	binary.Read(r, binary.LittleEndian, &timestamp)
+	binary.Read(r, binary.LittleEndian, &keyLen)
+	binary.Read(r, binary.LittleEndian, &valueLen)
+	binary.Read(r, binary.LittleEndian, &expiry)
+	err = binary.Read(r, binary.LittleEndian, &kind)
+	return
+}
+
+// indexSnapshot returns one IndexEntrySnapshot per live, non-chunked key
+// whose latest record was written at or after since, for serving a peer's
+// catch-up Index request.
+func (bc *Bitcask) indexSnapshot(since time.Time) []IndexEntrySnapshot {
+	sinceUnix := since.Unix()
+
+	var entries []IndexEntrySnapshot
+	bc.index.Range(func(k, v interface{}) bool {
+		entry := v.(IndexEntry)
+		if entry.Chunked || len(entry.Offsets) == 0 {
+			return true
+		}
+		offset := entry.Offsets[len(entry.Offsets)-1]
+
+		timestamp, crc, size, err := recordMeta(entry.FileName, offset)
+		if err != nil {
+			log.Printf("replication: reading metadata for key %q: %v", k.(string), err)
+			return true
+		}
+		if timestamp < sinceUnix {
+			return true
+		}
+
+		entries = append(entries, IndexEntrySnapshot{
+			Key:       k.(string),
+			FileName:  filepath.Base(entry.FileName),
+			Offset:    offset,
+			Timestamp: timestamp,
+			Size:      uint32(size),
+			CRC:       crc,
+		})
+		return true
+	})
+	return entries
+}
+
+// ReplicaStatus reports one configured peer's address and whether it was
+// reachable on the last check, for the /replicas status endpoint.
+type ReplicaStatus struct {
+	Addr      string
+	Reachable bool
+}
+
+// replicasHandler reports the reachability of every peer rp is configured
+// to publish to.
+func (rp *Replicator) replicasHandler(w http.ResponseWriter, r *http.Request) {
+	rp.mu.RLock()
+	peers := append([]string(nil), rp.peers...)
+	rp.mu.RUnlock()
+
+	statuses := make([]ReplicaStatus, len(peers))
+	for i, addr := range peers {
+		conn, err := net.DialTimeout("tcp", addr, replicationDialTimeout)
+		statuses[i] = ReplicaStatus{Addr: addr, Reachable: err == nil}
+		if err == nil {
+			conn.Close()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// RepoStatus reports one registered repo's name and live key count, for
+// the /repos status endpoint.
+type RepoStatus struct {
+	Repo     string
+	KeyCount int
+}
+
+// reposHandler reports every repo rp has had Registered, alphabetically.
+func (rp *Replicator) reposHandler(w http.ResponseWriter, r *http.Request) {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+
+	statuses := make([]RepoStatus, 0, len(rp.repos))
+	for repo, bc := range rp.repos {
+		count := 0
+		bc.index.Range(func(_, _ interface{}) bool {
+			count++
+			return true
+		})
+		statuses = append(statuses, RepoStatus{Repo: repo, KeyCount: count})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Repo < statuses[j].Repo })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
+
+// HTTP Handlers
+func (bc *Bitcask) putHandler(w http.ResponseWriter, r *http.Request) {
+	type Request struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+		TTL   string `json:"ttl,omitempty"`
+	}
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request", http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+
+	if err := bc.PutWithTTL(req.Key, req.Value, ttl); err != nil {
+		http.Error(w, "Failed to store key-value", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Key-Value stored successfully")
+}
+
+func (bc *Bitcask) getHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	values, err := bc.Get(key)
+	if err != nil {
+		switch err {
+		case ErrKeyExpired:
+			http.Error(w, "Key expired", http.StatusGone)
+		case ErrKeyNotFound:
+			http.Error(w, "Key not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Failed to read key", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(values)
+}
+
+func (bc *Bitcask) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := bc.Delete(key); err != nil {
+		http.Error(w, "Failed to delete key", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Key deleted successfully")
+}
+
+func (bc *Bitcask) mergeHandler(w http.ResponseWriter, r *http.Request) {
+	if err := bc.Merge(); err != nil {
+		http.Error(w, "Failed to merge segments", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Merge completed successfully")
+}
+
+func (bc *Bitcask) putStreamHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := bc.PutStream(key, r.Body); err != nil {
+		http.Error(w, "Failed to store stream", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Stream stored successfully")
+}
+
+func (bc *Bitcask) getStreamHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "Missing key parameter", http.StatusBadRequest)
+		return
+	}
+
+	stream, err := bc.GetStream(key)
+	if err != nil {
+		switch err {
+		case ErrKeyNotFound:
+			http.Error(w, "Key not found", http.StatusNotFound)
+		case ErrValueNotChunked:
+			http.Error(w, "Key was not stored with PutStream", http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to read stream", http.StatusInternalServerError)
+		}
+		return
+	}
+	defer stream.Close()
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, stream)
+}
+
+func (bc *Bitcask) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	report, err := bc.Verify()
+	if err != nil {
+		http.Error(w, "Failed to verify segments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// replicationPeers parses the comma-separated BITCASK_PEERS environment
+// variable into peer addresses, ignoring empty entries so an unset or
+// empty value means no peers and replication is effectively a no-op.
+func replicationPeers() []string {
+	var peers []string
+	for _, addr := range strings.Split(os.Getenv("BITCASK_PEERS"), ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			peers = append(peers, addr)
+		}
+	}
+	return peers
+}
+
+func main() {
+	// Initialize Bitcask store
+	store, err := NewBitcask("data/", 1024*900) // 900 KB max file size
+	if err != nil {
+		log.Fatalf("Error initializing Bitcask: %v", err)
+	}
+
+	// Replicator hosts the "default" repo and, if BITCASK_PEERS is set,
+	// publishes its Puts/Deletes to the listed peers; it accepts
+	// replication connections from peers on :8082.
+	replicator := NewReplicator(replicationPeers())
+	replicator.Register("default", store)
+	go func() {
+		if err := replicator.ListenAndServe(":8082"); err != nil {
+			log.Printf("replication: listener stopped: %v", err)
+		}
+	}()
+
 	// Set up HTTP server
 	http.HandleFunc("/put", store.putHandler)
 	http.HandleFunc("/get", store.getHandler)
+	http.HandleFunc("/delete", store.deleteHandler)
+	http.HandleFunc("/merge", store.mergeHandler)
+	http.HandleFunc("/putstream", store.putStreamHandler)
+	http.HandleFunc("/getstream", store.getStreamHandler)
+	http.HandleFunc("/verify", store.verifyHandler)
+	http.HandleFunc("/replicas", replicator.replicasHandler)
+	http.HandleFunc("/repos", replicator.reposHandler)
 
 	fmt.Println("Server running on :8081")
 	if err := http.ListenAndServe(":8081", nil); err != nil {
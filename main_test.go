@@ -0,0 +1,406 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTinyBitcask returns a Bitcask backed by a temp dir with a maxFileSize
+// small enough that every record written by these tests immediately rotates
+// its segment out of the active slot, so each Put lands in its own
+// non-active (and therefore Merge/recovery-eligible) segment file.
+func newTinyBitcask(t *testing.T) *Bitcask {
+	t.Helper()
+	bc, err := NewBitcask(t.TempDir(), 16)
+	if err != nil {
+		t.Fatalf("NewBitcask: %v", err)
+	}
+	return bc
+}
+
+func TestPutGetDelete(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("k1", "v1"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	values, err := bc.Get("k1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if got := values[len(values)-1]; got != "v1" {
+		t.Fatalf("Get returned %q, want %q", got, "v1")
+	}
+
+	if err := bc.Delete("k1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := bc.Get("k1"); err != ErrKeyNotFound {
+		t.Fatalf("Get after Delete = %v, want ErrKeyNotFound", err)
+	}
+}
+
+func TestMergeDropsTombstonesAndPreservesLiveKeys(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("live", "keep-me"); err != nil {
+		t.Fatalf("Put live: %v", err)
+	}
+	if err := bc.Put("gone", "temporary"); err != nil {
+		t.Fatalf("Put gone: %v", err)
+	}
+	if err := bc.Delete("gone"); err != nil {
+		t.Fatalf("Delete gone: %v", err)
+	}
+
+	before, err := bc.segmentFiles()
+	if err != nil {
+		t.Fatalf("segmentFiles: %v", err)
+	}
+	if len(before) == 0 {
+		t.Fatalf("expected at least one non-active segment before Merge")
+	}
+
+	if err := bc.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	values, err := bc.Get("live")
+	if err != nil {
+		t.Fatalf("Get live after Merge: %v", err)
+	}
+	if got := values[len(values)-1]; got != "keep-me" {
+		t.Fatalf("Get live after Merge = %q, want %q", got, "keep-me")
+	}
+	if _, err := bc.Get("gone"); err != ErrKeyNotFound {
+		t.Fatalf("Get gone after Merge = %v, want ErrKeyNotFound", err)
+	}
+
+	after, err := bc.segmentFiles()
+	if err != nil {
+		t.Fatalf("segmentFiles after Merge: %v", err)
+	}
+	for _, name := range before {
+		for _, still := range after {
+			if name == still {
+				t.Fatalf("obsolete segment %s was not removed by Merge", name)
+			}
+		}
+	}
+}
+
+// TestMergeRemovesObsoleteHintFiles covers a reviewer-flagged disk leak:
+// Merge must remove a compacted segment's companion .hint file alongside its
+// .log file, not just the .log file, or every Merge cycle over the life of a
+// long-running server leaves another orphaned hint file behind.
+func TestMergeRemovesObsoleteHintFiles(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("k1", "v1"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	before, err := bc.segmentFiles()
+	if err != nil || len(before) != 1 {
+		t.Fatalf("segmentFiles = %v, %v; want exactly one non-active segment", before, err)
+	}
+	hintPath := hintPathFor(filepath.Join(bc.dataDir, before[0]))
+	if _, err := os.Stat(hintPath); err != nil {
+		t.Fatalf("expected a hint file at %s after rotation: %v", hintPath, err)
+	}
+
+	if err := bc.Merge(); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if _, err := os.Stat(hintPath); !os.IsNotExist(err) {
+		t.Fatalf("hint file %s still present after Merge removed its segment: %v", hintPath, err)
+	}
+}
+
+// TestMergeDoesNotClobberConcurrentWrite exercises the race a reviewer
+// flagged against Merge's index-repoint loop: a Put landing on a key after
+// Merge read its old value but before Merge repoints the index must win,
+// not get overwritten back to the pre-merge value.
+//
+// The single concurrent Put is scheduled partway through a proxy measurement
+// of how long scanning and rewriting all the seed records should take, so it
+// lands somewhere in Merge's read/rewrite phase rather than racing
+// indefinitely until after Merge has already returned (at which point any
+// outcome would look correct regardless of whether the repoint loop
+// clobbers concurrent writes).
+func TestMergeDoesNotClobberConcurrentWrite(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	const key = "race-key"
+	const seedRecords = 3000
+	seedValue := strings.Repeat("s", 150)
+
+	start := time.Now()
+	for i := 0; i < seedRecords; i++ {
+		if err := bc.Put(key, seedValue); err != nil {
+			t.Fatalf("seeding Put %d: %v", i, err)
+		}
+	}
+	seedDuration := time.Since(start)
+	delay := seedDuration / 2
+	if delay <= 0 {
+		delay = time.Microsecond
+	}
+
+	const raceValue = "racing-value"
+	var wrote int32
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(delay)
+		if err := bc.Put(key, raceValue); err == nil {
+			atomic.StoreInt32(&wrote, 1)
+		}
+	}()
+
+	mergeErr := bc.Merge()
+	wg.Wait()
+	if mergeErr != nil {
+		t.Fatalf("Merge: %v", mergeErr)
+	}
+
+	if atomic.LoadInt32(&wrote) == 0 {
+		t.Skip("concurrent Put didn't land in time; timing-dependent test was inconclusive")
+	}
+
+	values, err := bc.Get(key)
+	if err != nil {
+		t.Fatalf("Get after Merge: %v", err)
+	}
+	if got := values[len(values)-1]; got != raceValue {
+		t.Fatalf("Merge clobbered a concurrent write: Get = %q, want %q", got, raceValue)
+	}
+}
+
+// TestMergeStopsAtCorruptTrailingRecord covers the other half of the same
+// review comment: a corrupt/truncated record with an out-of-range valueLen
+// must not panic or OOM Merge, and must not prevent the valid record before
+// it from surviving compaction.
+func TestMergeStopsAtCorruptTrailingRecord(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("good", "fine"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	segs, err := bc.segmentFiles()
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("segmentFiles = %v, %v; want exactly one non-active segment", segs, err)
+	}
+	path := filepath.Join(bc.dataDir, segs[0])
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatalf("opening segment for corruption: %v", err)
+	}
+	// A header with a valid (zero) keyLen but a valueLen far past
+	// maxValueLen and no value bytes behind it: the kind of truncated or
+	// corrupt tail a crash can leave, which must be bounds-checked and
+	// rejected before Merge tries to allocate valueLen bytes for it.
+	corruptHeader := make([]byte, recordHeaderSize)
+	corruptHeader[16] = 0x7F
+	corruptHeader[17] = 0x7F
+	corruptHeader[18] = 0x7F
+	corruptHeader[19] = 0x7F // valueLen (little-endian) now far past maxValueLen
+	if _, err := f.Write(corruptHeader); err != nil {
+		t.Fatalf("writing corrupt record: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("closing corrupted segment: %v", err)
+	}
+
+	if err := bc.Merge(); err != nil {
+		t.Fatalf("Merge on corrupt trailing record: %v", err)
+	}
+
+	values, err := bc.Get("good")
+	if err != nil {
+		t.Fatalf("Get good after Merge: %v", err)
+	}
+	if got := values[len(values)-1]; got != "fine" {
+		t.Fatalf("Get good after Merge = %q, want %q", got, "fine")
+	}
+}
+
+func TestPutWithTTLExpires(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.PutWithTTL("temp", "soon-gone", 10*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL: %v", err)
+	}
+
+	values, err := bc.Get("temp")
+	if err != nil {
+		t.Fatalf("Get before expiry: %v", err)
+	}
+	if got := values[len(values)-1]; got != "soon-gone" {
+		t.Fatalf("Get before expiry = %q, want %q", got, "soon-gone")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := bc.Get("temp"); err != ErrKeyExpired {
+		t.Fatalf("Get after expiry = %v, want ErrKeyExpired", err)
+	}
+}
+
+// TestHintFileRecoverySkipsExpiredKey covers the gap between the hint-file
+// fast path and the full-scan fallback: both must treat an already-expired
+// key as absent on recovery, not just the full scan.
+func TestHintFileRecoverySkipsExpiredKey(t *testing.T) {
+	dir := t.TempDir()
+
+	bc1, err := NewBitcask(dir, 16)
+	if err != nil {
+		t.Fatalf("NewBitcask: %v", err)
+	}
+	if err := bc1.PutWithTTL("temp", "soon-gone", 30*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL: %v", err)
+	}
+	segs, err := bc1.segmentFiles()
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("segmentFiles = %v, %v; want exactly one non-active (hinted) segment", segs, err)
+	}
+	hintPath := hintPathFor(filepath.Join(dir, segs[0]))
+	if _, err := os.Stat(hintPath); err != nil {
+		t.Fatalf("expected a hint file at %s after rotation: %v", hintPath, err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	bc2, err := NewBitcask(dir, 16)
+	if err != nil {
+		t.Fatalf("NewBitcask (recovery): %v", err)
+	}
+	if _, err := bc2.Get("temp"); err != ErrKeyNotFound {
+		t.Fatalf("Get after hint-file recovery = %v, want ErrKeyNotFound for an already-expired key", err)
+	}
+}
+
+// TestNewBitcaskResumesLastActiveSegment covers a reviewer-flagged restart
+// bug: NewBitcask must reopen the segment that was actually active when the
+// process last stopped, not unconditionally "segment.log" — otherwise a
+// restart abandons the true last-active segment mid-size and immediately
+// re-triggers rotation on the very next write.
+func TestNewBitcaskResumesLastActiveSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	bc1, err := NewBitcask(dir, 16)
+	if err != nil {
+		t.Fatalf("NewBitcask: %v", err)
+	}
+	if err := bc1.Put("k1", "v1"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := bc1.Put("k2", strings.Repeat("x", 8)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	wantActive := filepath.Base(bc1.currentFile.Name())
+	if wantActive == "segment.log" {
+		t.Fatalf("test setup didn't rotate past segment.log")
+	}
+
+	bc2, err := NewBitcask(dir, 16)
+	if err != nil {
+		t.Fatalf("NewBitcask (restart): %v", err)
+	}
+	if got := filepath.Base(bc2.currentFile.Name()); got != wantActive {
+		t.Fatalf("active segment after restart = %q, want %q (the true last-active segment)", got, wantActive)
+	}
+
+	segsBefore, err := bc1.listSegmentFiles()
+	if err != nil {
+		t.Fatalf("listSegmentFiles: %v", err)
+	}
+	segsAfter, err := bc2.listSegmentFiles()
+	if err != nil {
+		t.Fatalf("listSegmentFiles after restart: %v", err)
+	}
+	if len(segsAfter) != len(segsBefore) {
+		t.Fatalf("restart manufactured extra segments: before=%d after=%d", len(segsBefore), len(segsAfter))
+	}
+}
+
+func TestVerifyReportsCorruptRecord(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("good", "fine"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	segs, err := bc.segmentFiles()
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("segmentFiles = %v, %v; want exactly one non-active segment", segs, err)
+	}
+	path := filepath.Join(bc.dataDir, segs[0])
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading segment: %v", err)
+	}
+	valueStart := 1 + recordHeaderSize + len("good") // version byte + header + key
+	data[valueStart] ^= 0xFF
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing corrupted segment: %v", err)
+	}
+
+	report, err := bc.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.CorruptRecords != 1 {
+		t.Fatalf("report.CorruptRecords = %d, want 1 (report=%+v)", report.CorruptRecords, report)
+	}
+	if report.GoodRecords != 0 {
+		t.Fatalf("report.GoodRecords = %d, want 0 (report=%+v)", report.GoodRecords, report)
+	}
+}
+
+// TestVerifyDetectsFlippedKindByte covers a reviewer-flagged gap: the CRC
+// must cover the kind byte too, not just timestamp/key/value, otherwise
+// flipping a plain Put's kind to recordKindChunkFragment passes Verify as
+// good while scanSegment's chunk-fragment case silently drops the key from
+// the index instead of surfacing it as corruption.
+func TestVerifyDetectsFlippedKindByte(t *testing.T) {
+	bc := newTinyBitcask(t)
+
+	if err := bc.Put("good", "fine"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	segs, err := bc.segmentFiles()
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("segmentFiles = %v, %v; want exactly one non-active segment", segs, err)
+	}
+	path := filepath.Join(bc.dataDir, segs[0])
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading segment: %v", err)
+	}
+	kindOffset := 1 + recordHeaderSize - 1 // version byte + header, kind is the header's last byte
+	data[kindOffset] = recordKindChunkFragment
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing corrupted segment: %v", err)
+	}
+
+	report, err := bc.Verify()
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if report.CorruptRecords != 1 {
+		t.Fatalf("report.CorruptRecords = %d, want 1 (report=%+v)", report.CorruptRecords, report)
+	}
+	if report.GoodRecords != 0 {
+		t.Fatalf("report.GoodRecords = %d, want 0 (report=%+v)", report.GoodRecords, report)
+	}
+}